@@ -0,0 +1,209 @@
+// AST node types shared by the parser (see parser.go) and the
+// tree-walking evaluator. Keeping Op decoupled from tokenKind means
+// operator precedence and associativity only have to be described
+// once, in the parser's precedence table, rather than being smeared
+// across the old linked-list evaluation passes.
+package main
+
+import "fmt"
+
+// Op identifies the operator carried by a UnaryNode or BinaryNode.
+type Op int
+
+const (
+	OpAdd Op = iota
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpPow
+	OpEq
+	OpNeq
+	OpLt
+	OpLe
+	OpGt
+	OpGe
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpAdd:
+		return "+"
+	case OpSub:
+		return "-"
+	case OpMul:
+		return "*"
+	case OpDiv:
+		return "/"
+	case OpMod:
+		return "%"
+	case OpPow:
+		return "**"
+	case OpEq:
+		return "=="
+	case OpNeq:
+		return "!="
+	case OpLt:
+		return "<"
+	case OpLe:
+		return "<="
+	case OpGt:
+		return ">"
+	case OpGe:
+		return ">="
+	default:
+		return fmt.Sprintf("Op(%d)", int(op))
+	}
+}
+
+// Node is a single node of an expression's abstract syntax tree. Eval
+// walks the node (and, transitively, its children) to produce the
+// Value it represents (see value.go). env supplies variable bindings
+// for VariableNode and AssignNode; it may be nil, in which case a
+// VariableNode or AssignNode reports an error. Parse (see parser.go)
+// never produces an AssignNode, only ParseStatement does.
+type Node interface {
+	Eval(env *Env) (Value, error)
+}
+
+// NumberNode is a leaf node holding a literal numeric value.
+type NumberNode struct {
+	Value Value
+}
+
+// Eval returns the node's literal value.
+func (n *NumberNode) Eval(env *Env) (Value, error) {
+	return n.Value, nil
+}
+
+// VariableNode is a leaf node referring to a variable bound in env.
+type VariableNode struct {
+	Name string
+}
+
+// Eval looks Name up in env.
+func (n *VariableNode) Eval(env *Env) (Value, error) {
+	if env == nil {
+		return nil, fmt.Errorf("undefined variable %q", n.Name)
+	}
+	v, ok := env.Get(n.Name)
+	if !ok {
+		return nil, fmt.Errorf("undefined variable %q", n.Name)
+	}
+	return v, nil
+}
+
+// AssignNode stores the value of Value into env under Name, as
+// produced by parsing a "name = expr" statement.
+type AssignNode struct {
+	Name  string
+	Value Node
+}
+
+// Eval evaluates Value and binds the result to Name in env, also
+// returning it so the REPL can echo it back.
+func (n *AssignNode) Eval(env *Env) (Value, error) {
+	v, err := n.Value.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if env == nil {
+		return nil, fmt.Errorf("cannot assign %q without an environment", n.Name)
+	}
+	env.Set(n.Name, v)
+	return v, nil
+}
+
+// UnaryNode applies a prefix operator to a single child node.
+type UnaryNode struct {
+	Op    Op
+	Child Node
+}
+
+// Eval evaluates the child node and then applies the unary operator.
+func (n *UnaryNode) Eval(env *Env) (Value, error) {
+	v, err := n.Child.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch n.Op {
+	case OpAdd:
+		return v, nil
+	case OpSub:
+		return negateValue(v), nil
+	default:
+		return nil, fmt.Errorf("invalid unary operator: %v", n.Op)
+	}
+}
+
+// BinaryNode applies an infix operator to a left and right child.
+type BinaryNode struct {
+	Op          Op
+	Left, Right Node
+}
+
+// Eval evaluates both children and then combines them with the
+// binary operator. Arithmetic stays an IntValue when both operands
+// are IntValue (except an inexact division or a negative exponent),
+// and promotes to FloatValue otherwise; comparisons always give
+// IntValue 0 or 1 (see value.go).
+func (n *BinaryNode) Eval(env *Env) (Value, error) {
+	left, err := n.Left.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.Right.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch n.Op {
+	case OpAdd:
+		return addValues(left, right), nil
+	case OpSub:
+		return subValues(left, right), nil
+	case OpMul:
+		return mulValues(left, right), nil
+	case OpDiv:
+		return divValues(left, right)
+	case OpMod:
+		return modValues(left, right)
+	case OpPow:
+		return powValues(left, right), nil
+	case OpEq, OpNeq, OpLt, OpLe, OpGt, OpGe:
+		return compareValues(n.Op, left, right), nil
+	default:
+		return nil, fmt.Errorf("invalid binary operator: %v", n.Op)
+	}
+}
+
+// CallNode invokes a registered built-in function (see
+// RegisterFunc in funcs.go) with the value of each argument node.
+type CallNode struct {
+	Name string
+	Args []Node
+}
+
+// Eval evaluates each argument and dispatches to the registered
+// built-in named Name.
+func (n *CallNode) Eval(env *Env) (Value, error) {
+	fn, ok := builtins[n.Name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q", n.Name)
+	}
+	if len(n.Args) != fn.arity {
+		return nil, fmt.Errorf("%s takes %d argument(s), got %d", n.Name, fn.arity, len(n.Args))
+	}
+	args := make([]float64, len(n.Args))
+	for i, arg := range n.Args {
+		v, err := arg.Eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v.Float()
+	}
+	result, err := fn.fn(args)
+	if err != nil {
+		return nil, err
+	}
+	return FloatValue(result), nil
+}
@@ -12,47 +12,84 @@ package main
 import (
 	"bufio"
 	"fmt"
-	"log"
 	"os"
 	"unicode"
 )
 
 func main() {
 	input := bufio.NewScanner(os.Stdin)
+	env := NewEnv()
 	for {
 		fmt.Print("> ")
 		if !input.Scan() || input.Text() == "" { // Reads a line from standard input.
 			return // If it's empty, exit the program.
 		}
-		answer := Calculate(input.Text())
+		line := input.Text()
+		if handled, err := runCommand(line, env, os.Stdout); handled {
+			if err != nil {
+				fmt.Println("error:", err)
+			}
+			continue
+		}
+		answer, err := EvalIn(line, env)
+		if err != nil {
+			fmt.Println("error:", err)
+			continue
+		}
 		fmt.Println("answer =", answer)
 	}
 }
 
 // Calculate turns a string like "1 + 3" into its corresponding
-// numerical value (in this case 4).
-//メソッド名 引数 戻り値の型
-func Calculate(line string) float64 {
-	//数式文字列をトークンに分解する
-	HEAD, TAIL := tokenize(line)
-
-	//トークンを表示する
-	//printToken(HEAD)
-
-	// () を計算してトークンを組み替える
-	evaluateStartEnd(TAIL)
-
-	//トークンを表示する
-	//printToken(HEAD)
+// numerical value (in this case 4). It's a thin wrapper around
+// CalculateValue for callers that don't care whether the result was
+// computed as an IntValue or a FloatValue.
+func Calculate(line string) (float64, error) {
+	value, err := CalculateValue(line)
+	if err != nil {
+		return 0, err
+	}
+	return value.Float(), nil
+}
 
-	// * / を計算してトークンを組み替える
-	evaluateMulDiv(HEAD)
+// CalculateValue turns a string like "1 + 3" into the Value it
+// represents (see value.go), preserving exact integer results for as
+// long as the expression stays entirely in integers. It parses line
+// into an AST (see Parse in parser.go) and then walks it to produce
+// a value, without any variables in scope.
+func CalculateValue(line string) (Value, error) {
+	node, err := Parse(line)
+	if err != nil {
+		return nil, err
+	}
+	return evalNode(node, line, nil)
+}
 
-	//トークンを表示する
-	//printToken(HEAD)
+// EvalIn is Calculate's sibling for a REPL session: line may read or
+// assign variables held in env (see Env in env.go), and "ans" in env
+// is updated to the result of every successful call.
+func EvalIn(line string, env *Env) (float64, error) {
+	node, err := ParseStatement(line)
+	if err != nil {
+		return 0, err
+	}
+	value, err := evalNode(node, line, env)
+	if err != nil {
+		return 0, err
+	}
+	env.Set("ans", value)
+	return value.Float(), nil
+}
 
-	//計算結果を返す
-	return evaluatePlusMinus(HEAD)
+func evalNode(node Node, line string, env *Env) (Value, error) {
+	value, err := node.Eval(env)
+	if err != nil {
+		if calcErr, ok := err.(*CalcError); ok {
+			return nil, calcErr
+		}
+		return nil, &CalcError{Input: line, Pos: -1, Msg: err.Error()}
+	}
+	return value, nil
 }
 
 type token struct {
@@ -60,11 +97,19 @@ type token struct {
 	// rather than "type" because type is a reserved word in Go.
 	kind tokenKind
 
-	// If kind is Number, then number is its corresponding numeric
-	// value.
-	number float64
-	prev   *token
-	next   *token
+	// If kind is Number, then value is its corresponding numeric
+	// value (see value.go).
+	value Value
+
+	// If kind is Ident, then name is the identifier's text.
+	name string
+
+	// pos is the byte offset into the original input where this
+	// token starts, used to annotate CalcErrors with a column.
+	pos int
+
+	prev *token
+	next *token
 }
 
 // TokenKind describes a valid kinds of tokens. This acts kind of
@@ -81,54 +126,129 @@ const (
 	Minus
 	Multiple
 	Divide
+	Percent
+	Pow
 	Start
 	End
+	Comma
+	Ident
+	Eq
+	Neq
+	Lt
+	Le
+	Gt
+	Ge
+	Assign
 )
 
+// String returns a human-readable description of kind, suitable for
+// use in CalcError messages.
+func (kind tokenKind) String() string {
+	switch kind {
+	case Number:
+		return "number"
+	case Plus:
+		return "'+'"
+	case Minus:
+		return "'-'"
+	case Multiple:
+		return "'*'"
+	case Divide:
+		return "'/'"
+	case Percent:
+		return "'%'"
+	case Pow:
+		return "'**'"
+	case Start:
+		return "'('"
+	case End:
+		return "')'"
+	case Comma:
+		return "','"
+	case Ident:
+		return "identifier"
+	case Eq:
+		return "'=='"
+	case Neq:
+		return "'!='"
+	case Lt:
+		return "'<'"
+	case Le:
+		return "'<='"
+	case Gt:
+		return "'>'"
+	case Ge:
+		return "'>='"
+	case Assign:
+		return "'='"
+	default:
+		return "token"
+	}
+}
+
 // Tokenize lexes a given line, breaking it down into its component
-// tokens.
-//HEAD と TAIL を返す
-func tokenize(line string) (*token, *token) {
+// tokens, and returns the dummy HEAD token preceding them.
+func tokenize(line string) (*token, error) {
 	// Start with a dummy '+' token
-	HEAD := token{Plus, 0, nil, nil}
+	HEAD := token{kind: Plus}
 	prev := &HEAD
 	index := 0
-	flag := false
 	for index < len(line) {
 		var tok *token
 		switch {
+		case line[index] == ' ':
+			index++
+			continue
 		case unicode.IsDigit(rune(line[index])):
 			tok, index = readNumber(line, index)
-			if flag {
-				tok.number *= -1
-				flag = false
-			}
+		case isIdentStart(line[index]):
+			tok, index = readIdent(line, index)
 		case line[index] == '+':
 			tok, index = readPlus(line, index)
 		case line[index] == '-':
-			if prev.kind != Number {
-				flag = true
-				index++
-				continue
+			tok, index = readMinus(line, index)
+		case line[index] == '*':
+			if index+1 < len(line) && line[index+1] == '*' {
+				tok, index = readPow(line, index)
 			} else {
-				tok, index = readMinus(line, index)
+				tok, index = readMultiple(line, index)
 			}
-		case line[index] == '*':
-			tok, index = readMultiple(line, index)
 		case line[index] == '/':
 			tok, index = readDivide(line, index)
+		case line[index] == '%':
+			tok, index = readPercent(line, index)
 		case line[index] == '(':
 			tok, index = readStart(line, index)
 		case line[index] == ')':
 			tok, index = readEnd(line, index)
+		case line[index] == ',':
+			tok, index = readComma(line, index)
+		case line[index] == '=':
+			if index+1 < len(line) && line[index+1] == '=' {
+				tok, index = readEq(line, index)
+			} else {
+				tok, index = readAssign(line, index)
+			}
+		case line[index] == '!' && index+1 < len(line) && line[index+1] == '=':
+			tok, index = readNeq(line, index)
+		case line[index] == '<':
+			if index+1 < len(line) && line[index+1] == '=' {
+				tok, index = readLe(line, index)
+			} else {
+				tok, index = readLt(line, index)
+			}
+		case line[index] == '>':
+			if index+1 < len(line) && line[index+1] == '=' {
+				tok, index = readGe(line, index)
+			} else {
+				tok, index = readGt(line, index)
+			}
 		default:
-			//panicとはプログラムの継続的な実行が難しく、どうしよもなくなった時にプログラムを強制的に終了させるために発生するエラーです。
-			log.Panicf("invalid character: '%c' at index=%v in %v", line[index], index, line)
+			return nil, &CalcError{Input: line, Pos: index, Msg: fmt.Sprintf("unexpected character '%c'", line[index])}
 		}
 		prev = connectToken(prev, tok)
 	}
-	// means return HEAD and TAIL
-	return &HEAD, prev
+	return &HEAD, nil
 }
 
 func connectToken(prev *token, tok *token) *token {
@@ -137,173 +257,112 @@ func connectToken(prev *token, tok *token) *token {
 	return tok
 }
 
-func printToken(p *token) {
-	fmt.Printf("\n")
-	for {
-		fmt.Printf("%d %f\n", p.kind, p.number)
-		p = p.next
-		if p == nil {
-			break
-		}
-	}
-	fmt.Printf("\n")
+func readPlus(line string, index int) (*token, int) {
+	return &token{kind: Plus, pos: index}, index + 1
 }
 
-func evaluateStartEnd(TAIL *token) {
-	p := TAIL
-	for {
-		switch p.kind {
-		case Start:
-			//(の次の数字
-			tmpHead := p.next
-			//()のペアを見つける
-			for p.next.kind != End {
-				p = p.next
-			}
-			//)の前の数字
-			tmpEnd := p
-			p = calcStartEnd(tmpHead, tmpEnd)
-		default:
-			p = p.prev
-		}
+func readMinus(line string, index int) (*token, int) {
+	return &token{kind: Minus, pos: index}, index + 1
+}
 
-		if p == nil {
-			break
-		}
-	}
+func readMultiple(line string, index int) (*token, int) {
+	return &token{kind: Multiple, pos: index}, index + 1
 }
 
-func calcStartEnd(tmpHead *token, tmpEnd *token) *token {
-	new := &token{Number, 0, nil, nil}
-	replaceStartEnd(tmpHead, new, tmpEnd)
-	//()の中の式を前後から切り離す
-	// Start with a dummy '+' token
-	dummy := &token{Plus, 0, nil, tmpHead}
-	tmpHead.prev = dummy
-	tmpEnd.next = nil
-	evaluateMulDiv(dummy)
-	new.number = evaluatePlusMinus(dummy)
-	return new.prev
+func readDivide(line string, index int) (*token, int) {
+	return &token{kind: Divide, pos: index}, index + 1
 }
 
-func replaceStartEnd(tmpHead *token, new *token, tmpEnd *token) {
-	//tmpHead.prev.prevは必ずnilにならない(dummyが入ってるから)
-	tmpHead.prev.prev.next = new
-	new.prev = tmpHead.prev.prev
+func readPercent(line string, index int) (*token, int) {
+	return &token{kind: Percent, pos: index}, index + 1
+}
 
-	if tmpEnd.next.next != nil {
-		tmpEnd.next.next.prev = new
-		new.next = tmpEnd.next.next
-	}
+func readPow(line string, index int) (*token, int) {
+	return &token{kind: Pow, pos: index}, index + 2
 }
 
-func evaluateMulDiv(HEAD *token) {
-	p := HEAD
-	for {
-		switch p.kind {
-		case Multiple:
-			p = replaceMulDiv(p, calcMultiple(p))
-		case Divide:
-			p = replaceMulDiv(p, calcDivide(p))
-		default:
-			p = p.next
-		}
+func readStart(line string, index int) (*token, int) {
+	return &token{kind: Start, pos: index}, index + 1
+}
 
-		if p == nil {
-			break
-		}
-	}
+func readEnd(line string, index int) (*token, int) {
+	return &token{kind: End, pos: index}, index + 1
 }
 
-func calcMultiple(p *token) *token {
-	return &token{Number, p.prev.number * p.next.number, nil, nil}
+func readComma(line string, index int) (*token, int) {
+	return &token{kind: Comma, pos: index}, index + 1
 }
 
-func calcDivide(p *token) *token {
-	return &token{Number, p.prev.number / p.next.number, nil, nil}
+func readEq(line string, index int) (*token, int) {
+	return &token{kind: Eq, pos: index}, index + 2
 }
 
-func replaceMulDiv(p *token, new *token) *token {
-	if p.prev.prev != nil {
-		p.prev.prev.next = new
-		new.prev = p.prev.prev
-	}
-	if p.next.next != nil {
-		p.next.next.prev = new
-		new.next = p.next.next
-	}
-	return new.next
+func readAssign(line string, index int) (*token, int) {
+	return &token{kind: Assign, pos: index}, index + 1
 }
 
-// EvaluatePlusMinus computes the numeric value expressed by a series of
-// tokens.
-func evaluatePlusMinus(p *token) float64 {
-	answer := float64(0)
-	for {
-		switch p.kind {
-		case Number:
-			switch p.prev.kind {
-			case Plus:
-				answer += p.number
-			case Minus:
-				answer -= p.number
-			default:
-				log.Panicf("invalid syntax for token")
-			}
-		}
-		p = p.next
-		if p == nil {
-			break
-		}
-	}
-	return answer
+func readNeq(line string, index int) (*token, int) {
+	return &token{kind: Neq, pos: index}, index + 2
 }
 
-func readPlus(line string, index int) (*token, int) {
-	return &token{Plus, 0, nil, nil}, index + 1
+func readLt(line string, index int) (*token, int) {
+	return &token{kind: Lt, pos: index}, index + 1
 }
 
-func readMinus(line string, index int) (*token, int) {
-	return &token{Minus, 0, nil, nil}, index + 1
+func readLe(line string, index int) (*token, int) {
+	return &token{kind: Le, pos: index}, index + 2
 }
 
-func readMultiple(line string, index int) (*token, int) {
-	return &token{Multiple, 0, nil, nil}, index + 1
+func readGt(line string, index int) (*token, int) {
+	return &token{kind: Gt, pos: index}, index + 1
 }
 
-func readDivide(line string, index int) (*token, int) {
-	return &token{Divide, 0, nil, nil}, index + 1
+func readGe(line string, index int) (*token, int) {
+	return &token{kind: Ge, pos: index}, index + 2
 }
 
-func readStart(line string, index int) (*token, int) {
-	return &token{Start, 0, nil, nil}, index + 1
+// isIdentStart reports whether c can begin an identifier:
+// [A-Za-z_].
+func isIdentStart(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
 }
 
-func readEnd(line string, index int) (*token, int) {
-	return &token{End, 0, nil, nil}, index + 1
+// isIdentPart reports whether c can appear after the first character
+// of an identifier: [A-Za-z0-9_].
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || unicode.IsDigit(rune(c))
 }
 
+func readIdent(line string, index int) (*token, int) {
+	start := index
+	for index < len(line) && isIdentPart(line[index]) {
+		index++
+	}
+	return &token{kind: Ident, name: line[start:index], pos: start}, index
+}
+
+// readNumber reads a number literal starting at index. It produces
+// an IntValue unless a '.' is seen, in which case it produces a
+// FloatValue (see value.go); this is what lets an all-integer
+// expression stay exact through CalculateValue.
 func readNumber(line string, index int) (*token, int) {
-	number := float64(0)
-	flag := false
+	start := index
+	intPart := int64(0)
+	for index < len(line) && unicode.IsDigit(rune(line[index])) {
+		//'0'をひいて文字を数値に変換
+		intPart = intPart*10 + int64(line[index]-'0')
+		index++
+	}
+	if index >= len(line) || line[index] != '.' {
+		return &token{kind: Number, value: IntValue(intPart), pos: start}, index
+	}
+	index++ // skip the '.'
+	frac := float64(0)
 	keta := float64(1)
-DigitLoop:
-	for index < len(line) {
-		switch {
-		case line[index] == '.':
-			flag = true
-		case unicode.IsDigit(rune(line[index])):
-			//'0'をひいて文字を数値に変換
-			number = number*10 + float64(line[index]-'0')
-			if flag {
-				keta *= 0.1
-			}
-		default:
-			// "break DigitLoop" here means to break from the labeled for loop, rather than the switch statement. https://golang.org/ref/spec#Break_statements
-			break DigitLoop
-		}
-		index += 1
+	for index < len(line) && unicode.IsDigit(rune(line[index])) {
+		frac = frac*10 + float64(line[index]-'0')
+		keta *= 10
+		index++
 	}
-	//数値の時はたくさんindexを進める
-	return &token{Number, number * keta, nil, nil}, index
+	return &token{kind: Number, value: FloatValue(float64(intPart) + frac/keta), pos: start}, index
 }
@@ -0,0 +1,21 @@
+package main
+
+import "fmt"
+
+// CalcError describes a problem found while tokenizing, parsing, or
+// evaluating an expression. Pos is the byte offset into Input where
+// the problem was found; a negative Pos means the error isn't tied
+// to a single position (e.g. division by zero, which is only
+// discovered once evaluation reaches that node).
+type CalcError struct {
+	Input string
+	Pos   int
+	Msg   string
+}
+
+func (e *CalcError) Error() string {
+	if e.Pos < 0 {
+		return e.Msg
+	}
+	return fmt.Sprintf("%s at column %d", e.Msg, e.Pos+1)
+}
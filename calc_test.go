@@ -2,10 +2,7 @@
 package main
 
 import (
-	"fmt"
-	"log"
 	"math"
-	"runtime/debug"
 	"testing"
 )
 
@@ -114,13 +111,11 @@ func TestCalculate(t *testing.T) {
 		//(式)*(式)
 		{"(1+2)*(3+4)", 21},
 	} {
-		defer func() {
-			if r := recover(); r != nil {
-				t.Errorf("Calculate(%v) panicked(%v) but wanted %v", test.in, r, test.want)
-				t.Errorf("stacktrace: %s", debug.Stack())
-			}
-		}()
-		got := Calculate(test.in)
+		got, err := Calculate(test.in)
+		if err != nil {
+			t.Errorf("Calculate(%v) returned error %v, want %v", test.in, err, test.want)
+			continue
+		}
 		// floatだと完全には一致しないのでとっても近いかどうかを判定している。
 		if math.Abs(got-test.want) > tolerance {
 			t.Errorf("Calculate(%v) = %v but want %v", test.in, got, test.want)
@@ -128,34 +123,145 @@ func TestCalculate(t *testing.T) {
 	}
 }
 
-func TestCalculatePanics(t *testing.T) {
+// TestCalculateErrors checks that invalid input produces a returned
+// error instead of a panic.
+func TestCalculateErrors(t *testing.T) {
 	for _, test := range []struct {
 		in   string
 		want string
 	}{
-		//0で割った時に正しいエラー文が出るかどうかのチェックを追加したい
-		{"0/0", "can't divide by 0"},
-		{"1/0", "this doesn't break but it should."},
+		//0で割った時に正しいエラーが返るかどうかのチェック
+		{"0/0", "division by zero"},
+		{"1/0", "division by zero"},
+
+		{"1+", "unexpected end of input at column 3"},
+		{"1+)", "unexpected ')' at column 3"},
+		{"(1+2", "missing closing ')' at column 5"},
+		{"1+@", "unexpected character '@' at column 3"},
+	} {
+		_, err := Calculate(test.in)
+		if err == nil {
+			t.Errorf("Calculate(%v) = no error, want error %q", test.in, test.want)
+			continue
+		}
+		if got := err.Error(); got != test.want {
+			t.Errorf("Calculate(%v) error = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+// TestCalculateValue checks that CalculateValue keeps all-integer
+// expressions exact (as IntValue) instead of routing them through
+// float64, where results wider than 2^53 lose precision.
+func TestCalculateValue(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want Value
+	}{
+		{"2 * 2 * 2 * 2 * 2", IntValue(32)},
+		{"1+2", IntValue(3)},
+		{"1-5", IntValue(-4)},
+		{"4/2", IntValue(2)},
+
+		//整数同士でも割り切れない時はfloatになる
+		{"1/2", FloatValue(0.5)},
+
+		//片方がfloatならfloatになる
+		{"1+2.0", FloatValue(3)},
+
+		//float64では誤差が出てしまう桁数の整数演算
+		{"9007199254740993 - 9007199254740992", IntValue(1)},
 	} {
-		// When panic is called the whole calling function is
-		// terminated. So unless we're calling Calculate from within
-		// another function (missing in this case!), we would (and
-		// do!) stop the for loop at the first panic (so we won't
-		// actually catch a test case if it were wrong).
-
-		// NOTE: This example is wrong. In this case we've removed the
-		// surrounding function, so when the first test case panics,
-		// the whole test case terminates without reporting a failure.
-		defer func() {
-			panicked := fmt.Sprint(recover())
-			if panicked != test.want {
-				t.Errorf("Calculate(%v) had panicked = `%v` but wanted panic: %v", test.in, panicked, test.want)
-			}
-		}()
-		log.Printf("run %v", test.in)
-		Calculate(test.in)
-		// The defered function above executes anyway and will
-		// report an error unless panicked matches the expected
-		// value.
+		got, err := CalculateValue(test.in)
+		if err != nil {
+			t.Errorf("CalculateValue(%v) returned error %v, want %v", test.in, err, test.want)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("CalculateValue(%v) = %#v, want %#v", test.in, got, test.want)
+		}
+	}
+}
+
+// TestCalculateExtendedGrammar checks modulo, exponentiation, unary
+// operators, comparisons, and built-in function calls.
+func TestCalculateExtendedGrammar(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want Value
+	}{
+		//剰余
+		{"7 % 3", IntValue(1)},
+		{"7.5 % 2", FloatValue(1.5)},
+
+		//べき乗(右結合)
+		{"2 ** 3", IntValue(8)},
+		{"2 ** 3 ** 2", IntValue(512)},
+		{"2.0 ** 0.5", FloatValue(math.Sqrt(2))},
+
+		//単項演算子
+		{"-2 ** 2", IntValue(-4)},
+		{"-2 * 3", IntValue(-6)},
+		{"+5", IntValue(5)},
+		{"-(2+3)", IntValue(-5)},
+
+		//比較演算子
+		{"1 < 2", IntValue(1)},
+		{"2 <= 2", IntValue(1)},
+		{"3 == 3.0", IntValue(1)},
+		{"3 != 3", IntValue(0)},
+		{"5 > 10", IntValue(0)},
+		{"5 >= 5", IntValue(1)},
+
+		//組み込み関数
+		{"sqrt(4)", FloatValue(2)},
+		{"abs(-3)", FloatValue(3)},
+		{"min(2, 5)", FloatValue(2)},
+		{"max(2, 5)", FloatValue(5)},
+		{"pow(2, 10)", FloatValue(1024)},
+	} {
+		got, err := CalculateValue(test.in)
+		if err != nil {
+			t.Errorf("CalculateValue(%v) returned error %v, want %v", test.in, err, test.want)
+			continue
+		}
+		if math.Abs(got.Float()-test.want.Float()) > tolerance {
+			t.Errorf("CalculateValue(%v) = %#v, want %#v", test.in, got, test.want)
+		}
+	}
+}
+
+// TestEvalInVariables checks that EvalIn threads variable assignments
+// and "ans" through a shared Env across a sequence of lines.
+func TestEvalInVariables(t *testing.T) {
+	env := NewEnv()
+	for _, test := range []struct {
+		in   string
+		want float64
+	}{
+		{"x = 1+2", 3},
+		{"y = x*3", 9},
+		{"y+1", 10},
+		{"ans*2", 20},
+		{"z = ans", 20},
+		{"z - x", 17},
+	} {
+		got, err := EvalIn(test.in, env)
+		if err != nil {
+			t.Errorf("EvalIn(%v) returned error %v, want %v", test.in, err, test.want)
+			continue
+		}
+		if math.Abs(got-test.want) > tolerance {
+			t.Errorf("EvalIn(%v) = %v, want %v", test.in, got, test.want)
+		}
+	}
+}
+
+// TestEvalInUndefinedVariable checks that referencing an unbound
+// variable returns an error instead of panicking.
+func TestEvalInUndefinedVariable(t *testing.T) {
+	env := NewEnv()
+	if _, err := EvalIn("x+1", env); err == nil {
+		t.Errorf("EvalIn(x+1) = no error, want undefined variable error")
 	}
 }
@@ -0,0 +1,131 @@
+// The tree-walking evaluator in ast.go re-parses nothing but does
+// redo every arithmetic decision (which Op, is it still an IntValue,
+// ...) on every Eval call. For an expression that's evaluated many
+// times, it's cheaper to decide all of that once and compile it down
+// to a flat list of instructions that a small stack machine (see
+// vm.go) can replay quickly. Compile does exactly that.
+package main
+
+import "fmt"
+
+// opcode identifies a single VM instruction.
+type opcode int
+
+const (
+	opConstF opcode = iota // push Consts[fidx]
+	opNeg                  // pop a; push -a
+	opAdd                  // pop b, a; push a+b
+	opSub                  // pop b, a; push a-b
+	opMul                  // pop b, a; push a*b
+	opDiv                  // pop b, a; push a/b
+	opMod                  // pop b, a; push a%b (as math.Mod)
+	opPow                  // pop b, a; push a**b
+	opEq                   // pop b, a; push 1 if a == b else 0
+	opNeq                  // pop b, a; push 1 if a != b else 0
+	opLt                   // pop b, a; push 1 if a < b else 0
+	opLe                   // pop b, a; push 1 if a <= b else 0
+	opGt                   // pop b, a; push 1 if a > b else 0
+	opGe                   // pop b, a; push 1 if a >= b else 0
+	opLoad                 // push vars[name]
+	opCall                 // pop nargs values; push builtins[name](...)
+)
+
+// instr is a single VM instruction. Which fields are meaningful
+// depends on op: fidx indexes Program.Consts for opConstF, and name
+// (plus nargs, for opCall) names a variable or built-in function.
+type instr struct {
+	op    opcode
+	fidx  int
+	name  string
+	nargs int
+}
+
+// Program is the result of compiling an expression: a flat
+// instruction list plus the constant pool it indexes into.
+type Program struct {
+	Consts []float64
+	Code   []instr
+}
+
+// Compile parses line and lowers its AST into a Program that a VM
+// (see vm.go) can execute directly, without re-walking the tree.
+func Compile(line string) (*Program, error) {
+	node, err := Parse(line)
+	if err != nil {
+		return nil, err
+	}
+	c := &compiler{prog: &Program{}}
+	if err := c.compileNode(node); err != nil {
+		return nil, err
+	}
+	return c.prog, nil
+}
+
+type compiler struct {
+	prog *Program
+}
+
+func (c *compiler) emit(i instr) {
+	c.prog.Code = append(c.prog.Code, i)
+}
+
+// binaryOpcodes maps an AST Op (see ast.go) to the VM opcode that
+// implements it.
+var binaryOpcodes = map[Op]opcode{
+	OpAdd: opAdd,
+	OpSub: opSub,
+	OpMul: opMul,
+	OpDiv: opDiv,
+	OpMod: opMod,
+	OpPow: opPow,
+	OpEq:  opEq,
+	OpNeq: opNeq,
+	OpLt:  opLt,
+	OpLe:  opLe,
+	OpGt:  opGt,
+	OpGe:  opGe,
+}
+
+func (c *compiler) compileNode(node Node) error {
+	switch n := node.(type) {
+	case *NumberNode:
+		c.emit(instr{op: opConstF, fidx: len(c.prog.Consts)})
+		c.prog.Consts = append(c.prog.Consts, n.Value.Float())
+		return nil
+	case *UnaryNode:
+		if err := c.compileNode(n.Child); err != nil {
+			return err
+		}
+		switch n.Op {
+		case OpAdd: // unary plus is a no-op
+		case OpSub:
+			c.emit(instr{op: opNeg})
+		default:
+			return fmt.Errorf("compiler: unsupported unary operator %v", n.Op)
+		}
+		return nil
+	case *BinaryNode:
+		if err := c.compileNode(n.Left); err != nil {
+			return err
+		}
+		if err := c.compileNode(n.Right); err != nil {
+			return err
+		}
+		op, ok := binaryOpcodes[n.Op]
+		if !ok {
+			return fmt.Errorf("compiler: unsupported binary operator %v", n.Op)
+		}
+		c.emit(instr{op: op})
+		return nil
+	case *CallNode:
+		for _, arg := range n.Args {
+			if err := c.compileNode(arg); err != nil {
+				return err
+			}
+		}
+		c.emit(instr{op: opCall, name: n.Name, nargs: len(n.Args)})
+		return nil
+	default:
+		return fmt.Errorf("compiler: unsupported node type %T", n)
+	}
+}
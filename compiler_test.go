@@ -0,0 +1,81 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCompileAndRun(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want float64
+	}{
+		{"1+2*3", 7},
+		{"(1+2)*3", 9},
+		{"2**10", 1024},
+		{"7 % 3", 1},
+		{"-2*3", -6},
+		{"1 < 2", 1},
+		{"sqrt(4)+min(2,5)", 4},
+	} {
+		prog, err := Compile(test.in)
+		if err != nil {
+			t.Errorf("Compile(%v) returned error %v", test.in, err)
+			continue
+		}
+		got, err := NewVM(prog).Run(nil)
+		if err != nil {
+			t.Errorf("Run(%v) returned error %v", test.in, err)
+			continue
+		}
+		if math.Abs(got-test.want) > tolerance {
+			t.Errorf("Run(%v) = %v, want %v", test.in, got, test.want)
+		}
+	}
+}
+
+func TestCompileDivisionByZero(t *testing.T) {
+	prog, err := Compile("1/0")
+	if err != nil {
+		t.Fatalf("Compile(1/0) returned error %v", err)
+	}
+	if _, err := NewVM(prog).Run(nil); err == nil {
+		t.Errorf("Run(1/0) = no error, want division by zero")
+	}
+}
+
+// benchWorkload mirrors the "100k evaluations of the same
+// expression" scenario (e.g. a plot or spreadsheet re-evaluating a
+// formula) that motivates compiling once and running many times.
+const benchWorkload = 100000
+
+const benchExpr = "1+2*3-4/2+5%3"
+
+func BenchmarkTreeWalkEval(b *testing.B) {
+	node, err := Parse(benchExpr)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < benchWorkload; j++ {
+			if _, err := node.Eval(nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkVMEval(b *testing.B) {
+	prog, err := Compile(benchExpr)
+	if err != nil {
+		b.Fatal(err)
+	}
+	vm := NewVM(prog)
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < benchWorkload; j++ {
+			if _, err := vm.Run(nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
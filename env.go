@@ -0,0 +1,42 @@
+package main
+
+import "sort"
+
+// Env holds the variable bindings of a REPL session (see EvalIn in
+// calc.go): everything assigned with "name = expr", plus the special
+// "ans" variable, which is always set to the most recently computed
+// result.
+type Env struct {
+	vars map[string]Value
+}
+
+// NewEnv returns an empty environment.
+func NewEnv() *Env {
+	return &Env{vars: map[string]Value{}}
+}
+
+// Get looks up name, reporting whether it's bound.
+func (e *Env) Get(name string) (Value, bool) {
+	v, ok := e.vars[name]
+	return v, ok
+}
+
+// Set binds name to v, overwriting any previous binding.
+func (e *Env) Set(name string, v Value) {
+	e.vars[name] = v
+}
+
+// Clear removes every binding from the environment.
+func (e *Env) Clear() {
+	e.vars = map[string]Value{}
+}
+
+// Names returns every bound variable name, sorted.
+func (e *Env) Names() []string {
+	names := make([]string, 0, len(e.vars))
+	for name := range e.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
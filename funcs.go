@@ -0,0 +1,32 @@
+package main
+
+import "math"
+
+// builtinFunc is a registered function callable from expressions as
+// name(arg1, arg2, ...).
+type builtinFunc struct {
+	arity int
+	fn    func([]float64) (float64, error)
+}
+
+// builtins holds every function registered with RegisterFunc,
+// looked up by CallNode.Eval (see ast.go).
+var builtins = map[string]builtinFunc{}
+
+// RegisterFunc makes fn callable from expressions under name, taking
+// exactly arity arguments. Calling it with the wrong number of
+// arguments is an evaluation-time error.
+func RegisterFunc(name string, arity int, fn func([]float64) (float64, error)) {
+	builtins[name] = builtinFunc{arity: arity, fn: fn}
+}
+
+func init() {
+	RegisterFunc("sqrt", 1, func(args []float64) (float64, error) { return math.Sqrt(args[0]), nil })
+	RegisterFunc("sin", 1, func(args []float64) (float64, error) { return math.Sin(args[0]), nil })
+	RegisterFunc("cos", 1, func(args []float64) (float64, error) { return math.Cos(args[0]), nil })
+	RegisterFunc("log", 1, func(args []float64) (float64, error) { return math.Log(args[0]), nil })
+	RegisterFunc("abs", 1, func(args []float64) (float64, error) { return math.Abs(args[0]), nil })
+	RegisterFunc("min", 2, func(args []float64) (float64, error) { return math.Min(args[0], args[1]), nil })
+	RegisterFunc("max", 2, func(args []float64) (float64, error) { return math.Max(args[0], args[1]), nil })
+	RegisterFunc("pow", 2, func(args []float64) (float64, error) { return math.Pow(args[0], args[1]), nil })
+}
@@ -0,0 +1,204 @@
+package main
+
+import "fmt"
+
+// precedence ranks how tightly a binary operator binds. Higher
+// values bind tighter, so "*"/"/"/"%" (precProduct) are parsed
+// before "+"/"-" (precSum), and unary "+"/"-" (precUnary) bind
+// tighter still. "**" (precPower) binds tighter than unary, so that
+// e.g. "-2**2" parses as "-(2**2)".
+type precedence int
+
+const (
+	precLowest precedence = iota
+	precComparison
+	precSum
+	precProduct
+	precUnary
+	precPower
+)
+
+// binaryOps maps a token's kind to the operator, precedence, and
+// associativity it represents when found in infix position.
+// Everything the parser needs to know about an operator's precedence
+// and associativity lives here, rather than being spread across
+// separate evaluation passes.
+var binaryOps = map[tokenKind]struct {
+	op         Op
+	prec       precedence
+	rightAssoc bool
+}{
+	Eq:       {OpEq, precComparison, false},
+	Neq:      {OpNeq, precComparison, false},
+	Lt:       {OpLt, precComparison, false},
+	Le:       {OpLe, precComparison, false},
+	Gt:       {OpGt, precComparison, false},
+	Ge:       {OpGe, precComparison, false},
+	Plus:     {OpAdd, precSum, false},
+	Minus:    {OpSub, precSum, false},
+	Multiple: {OpMul, precProduct, false},
+	Divide:   {OpDiv, precProduct, false},
+	Percent:  {OpMod, precProduct, false},
+	Pow:      {OpPow, precPower, true},
+}
+
+// parser walks the token list produced by tokenize and builds an AST
+// out of it using precedence climbing (a.k.a. a Pratt parser).
+type parser struct {
+	cur  *token
+	line string
+}
+
+// Parse turns a string like "1 + 3" into the AST node representing
+// it.
+func Parse(line string) (Node, error) {
+	head, err := tokenize(line)
+	if err != nil {
+		return nil, err
+	}
+	return parseTokens(head.next, line)
+}
+
+// ParseStatement is Parse's sibling for a REPL session: it also
+// recognizes "name = expr" as an assignment, producing an AssignNode
+// (see ast.go), and otherwise parses line as a plain expression.
+func ParseStatement(line string) (Node, error) {
+	head, err := tokenize(line)
+	if err != nil {
+		return nil, err
+	}
+	if first := head.next; first != nil && first.kind == Ident && first.next != nil && first.next.kind == Assign {
+		value, err := parseTokens(first.next.next, line)
+		if err != nil {
+			return nil, err
+		}
+		return &AssignNode{Name: first.name, Value: value}, nil
+	}
+	return parseTokens(head.next, line)
+}
+
+// parseTokens parses the expression starting at start (the first
+// token after tokenize's dummy head, or after the '=' of an
+// assignment), and checks that nothing is left over afterwards.
+func parseTokens(start *token, line string) (Node, error) {
+	p := &parser{cur: start, line: line}
+	node, err := p.parseExpr(precLowest)
+	if err != nil {
+		return nil, err
+	}
+	if p.cur != nil {
+		return nil, &CalcError{Input: line, Pos: p.cur.pos, Msg: fmt.Sprintf("unexpected %s", p.cur.kind)}
+	}
+	return node, nil
+}
+
+// parseExpr parses a (possibly compound) expression, only consuming
+// binary operators whose precedence is at least minPrec. Left
+// associativity falls out of recursing with prec+1 on the right-hand
+// side; right associativity (for "**") recurses with prec instead,
+// letting a chain like "2**3**2" fold up from the right.
+func (p *parser) parseExpr(minPrec precedence) (Node, error) {
+	left, err := p.parsePrefix()
+	if err != nil {
+		return nil, err
+	}
+	for p.cur != nil {
+		info, ok := binaryOps[p.cur.kind]
+		if !ok || info.prec < minPrec {
+			break
+		}
+		p.cur = p.cur.next
+		nextMinPrec := info.prec + 1
+		if info.rightAssoc {
+			nextMinPrec = info.prec
+		}
+		right, err := p.parseExpr(nextMinPrec)
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryNode{Op: info.op, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// parsePrefix parses a single operand: a number literal, a variable
+// reference, a parenthesized sub-expression, a function call, or a
+// unary "+"/"-".
+func (p *parser) parsePrefix() (Node, error) {
+	tok := p.cur
+	if tok == nil {
+		return nil, &CalcError{Input: p.line, Pos: len(p.line), Msg: "unexpected end of input"}
+	}
+	switch tok.kind {
+	case Number:
+		p.cur = tok.next
+		return &NumberNode{Value: tok.value}, nil
+	case Plus, Minus:
+		p.cur = tok.next
+		child, err := p.parseExpr(precUnary)
+		if err != nil {
+			return nil, err
+		}
+		op := OpAdd
+		if tok.kind == Minus {
+			op = OpSub
+		}
+		return &UnaryNode{Op: op, Child: child}, nil
+	case Ident:
+		if tok.next != nil && tok.next.kind == Start {
+			return p.parseCall(tok)
+		}
+		p.cur = tok.next
+		return &VariableNode{Name: tok.name}, nil
+	case Start:
+		p.cur = tok.next
+		node, err := p.parseExpr(precLowest)
+		if err != nil {
+			return nil, err
+		}
+		if p.cur == nil {
+			return nil, &CalcError{Input: p.line, Pos: len(p.line), Msg: "missing closing ')'"}
+		}
+		if p.cur.kind != End {
+			return nil, &CalcError{Input: p.line, Pos: p.cur.pos, Msg: fmt.Sprintf("unexpected %s, want ')'", p.cur.kind)}
+		}
+		p.cur = p.cur.next
+		return node, nil
+	default:
+		return nil, &CalcError{Input: p.line, Pos: tok.pos, Msg: fmt.Sprintf("unexpected %s", tok.kind)}
+	}
+}
+
+// parseCall parses a call to a built-in function: ident(expr, expr, ...).
+func (p *parser) parseCall(tok *token) (Node, error) {
+	p.cur = tok.next
+	if p.cur == nil || p.cur.kind != Start {
+		return nil, &CalcError{Input: p.line, Pos: tok.pos, Msg: fmt.Sprintf("expected '(' after %q", tok.name)}
+	}
+	p.cur = p.cur.next // consume '('
+
+	var args []Node
+	if p.cur != nil && p.cur.kind != End {
+		for {
+			arg, err := p.parseExpr(precLowest)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.cur != nil && p.cur.kind == Comma {
+				p.cur = p.cur.next
+				continue
+			}
+			break
+		}
+	}
+
+	if p.cur == nil {
+		return nil, &CalcError{Input: p.line, Pos: len(p.line), Msg: "missing closing ')'"}
+	}
+	if p.cur.kind != End {
+		return nil, &CalcError{Input: p.line, Pos: p.cur.pos, Msg: fmt.Sprintf("unexpected %s, want ')'", p.cur.kind)}
+	}
+	p.cur = p.cur.next
+	return &CallNode{Name: tok.name, Args: args}, nil
+}
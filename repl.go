@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// runCommand recognizes the REPL-only commands ":vars", ":clear",
+// and ":load <file>"; anything else is left for main to evaluate as
+// an expression. handled reports whether line was one of these
+// commands.
+func runCommand(line string, env *Env, out io.Writer) (handled bool, err error) {
+	if !strings.HasPrefix(line, ":") {
+		return false, nil
+	}
+	fields := strings.Fields(line)
+	switch fields[0] {
+	case ":vars":
+		for _, name := range env.Names() {
+			v, _ := env.Get(name)
+			fmt.Fprintf(out, "%s = %v\n", name, v.Float())
+		}
+		return true, nil
+	case ":clear":
+		env.Clear()
+		return true, nil
+	case ":load":
+		if len(fields) != 2 {
+			return true, fmt.Errorf("usage: :load <file>")
+		}
+		return true, loadFile(fields[1], env, out)
+	default:
+		return true, fmt.Errorf("unknown command %q", fields[0])
+	}
+}
+
+// loadFile evaluates each non-blank line of path in turn as an
+// expression or assignment, printing results and errors the same way
+// the REPL would. REPL commands such as ":vars" are not recognized in
+// the file.
+func loadFile(path string, env *Env, out io.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		answer, err := EvalIn(line, env)
+		if err != nil {
+			fmt.Fprintln(out, "error:", err)
+			continue
+		}
+		fmt.Fprintln(out, "answer =", answer)
+	}
+	return scanner.Err()
+}
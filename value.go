@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Value is the result of evaluating an expression. IntValue keeps
+// expressions exact for as long as every operand along the way was
+// itself an IntValue; as soon as a FloatValue (or an inexact
+// division) enters the picture, the result promotes to FloatValue.
+// Comparisons are the exception: they always give IntValue 0 or 1.
+type Value interface {
+	// Float returns the value as a float64, converting if necessary.
+	Float() float64
+}
+
+// IntValue is an exact integer result.
+type IntValue int64
+
+// Float implements Value.
+func (v IntValue) Float() float64 { return float64(v) }
+
+// FloatValue is an inexact, floating-point result.
+type FloatValue float64
+
+// Float implements Value.
+func (v FloatValue) Float() float64 { return float64(v) }
+
+// negateValue returns -v, preserving v's concrete type.
+func negateValue(v Value) Value {
+	switch v := v.(type) {
+	case IntValue:
+		return -v
+	case FloatValue:
+		return -v
+	default:
+		return FloatValue(-v.Float())
+	}
+}
+
+// addValues, subValues, and mulValues stay in IntValue when both
+// operands are IntValue, and fall back to FloatValue otherwise.
+
+func addValues(left, right Value) Value {
+	if l, r, ok := bothInt(left, right); ok {
+		return l + r
+	}
+	return FloatValue(left.Float() + right.Float())
+}
+
+func subValues(left, right Value) Value {
+	if l, r, ok := bothInt(left, right); ok {
+		return l - r
+	}
+	return FloatValue(left.Float() - right.Float())
+}
+
+func mulValues(left, right Value) Value {
+	if l, r, ok := bothInt(left, right); ok {
+		return l * r
+	}
+	return FloatValue(left.Float() * right.Float())
+}
+
+// divValues stays in IntValue only when both operands are IntValue
+// and the division is exact; it always reports an error on division
+// by zero, regardless of operand type.
+func divValues(left, right Value) (Value, error) {
+	if right.Float() == 0 {
+		return nil, fmt.Errorf("division by zero")
+	}
+	if l, r, ok := bothInt(left, right); ok && l%r == 0 {
+		return l / r, nil
+	}
+	return FloatValue(left.Float() / right.Float()), nil
+}
+
+func bothInt(left, right Value) (IntValue, IntValue, bool) {
+	l, lok := left.(IntValue)
+	r, rok := right.(IntValue)
+	return l, r, lok && rok
+}
+
+// modValues stays in IntValue when both operands are IntValue, and
+// falls back to FloatValue (via math.Mod) otherwise. Like division,
+// it reports an error on modulo by zero regardless of operand type.
+func modValues(left, right Value) (Value, error) {
+	if right.Float() == 0 {
+		return nil, fmt.Errorf("modulo by zero")
+	}
+	if l, r, ok := bothInt(left, right); ok {
+		return l % r, nil
+	}
+	return FloatValue(math.Mod(left.Float(), right.Float())), nil
+}
+
+// powValues stays in IntValue when both operands are IntValue and
+// the exponent is non-negative, and falls back to FloatValue (via
+// math.Pow) otherwise.
+func powValues(left, right Value) Value {
+	if l, r, ok := bothInt(left, right); ok && r >= 0 {
+		return intPow(l, r)
+	}
+	return FloatValue(math.Pow(left.Float(), right.Float()))
+}
+
+func intPow(base, exp IntValue) IntValue {
+	result := IntValue(1)
+	for ; exp > 0; exp-- {
+		result *= base
+	}
+	return result
+}
+
+// compareValues evaluates a comparison operator, always comparing as
+// float64, and returns IntValue(1) for true or IntValue(0) for
+// false.
+func compareValues(op Op, left, right Value) Value {
+	l, r := left.Float(), right.Float()
+	var result bool
+	switch op {
+	case OpEq:
+		result = l == r
+	case OpNeq:
+		result = l != r
+	case OpLt:
+		result = l < r
+	case OpLe:
+		result = l <= r
+	case OpGt:
+		result = l > r
+	case OpGe:
+		result = l >= r
+	}
+	if result {
+		return IntValue(1)
+	}
+	return IntValue(0)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// stackSize bounds how deep the VM's evaluation stack can grow,
+// well beyond anything a real expression should need.
+const stackSize = 256
+
+// VM executes a compiled Program (see compiler.go) against a fixed-
+// size float64 stack. A VM can be reused across calls to Run.
+type VM struct {
+	Program *Program
+
+	stack [stackSize]float64
+	sp    int
+}
+
+// NewVM returns a VM that executes prog.
+func NewVM(prog *Program) *VM {
+	return &VM{Program: prog}
+}
+
+func (vm *VM) push(v float64) error {
+	if vm.sp >= len(vm.stack) {
+		return fmt.Errorf("vm: stack overflow")
+	}
+	vm.stack[vm.sp] = v
+	vm.sp++
+	return nil
+}
+
+func (vm *VM) pop() float64 {
+	vm.sp--
+	return vm.stack[vm.sp]
+}
+
+// Run executes vm.Program and returns the value it computes. vars
+// supplies the value of any variable an opLoad instruction refers
+// to; it may be nil for a Program that doesn't reference any. Compile
+// rejects variable references, so a Program it produces contains no
+// opLoad.
+func (vm *VM) Run(vars map[string]float64) (float64, error) {
+	vm.sp = 0
+	for _, in := range vm.Program.Code {
+		switch in.op {
+		case opConstF:
+			if err := vm.push(vm.Program.Consts[in.fidx]); err != nil {
+				return 0, err
+			}
+		case opNeg:
+			if err := vm.push(-vm.pop()); err != nil {
+				return 0, err
+			}
+		case opAdd:
+			b, a := vm.pop(), vm.pop()
+			if err := vm.push(a + b); err != nil {
+				return 0, err
+			}
+		case opSub:
+			b, a := vm.pop(), vm.pop()
+			if err := vm.push(a - b); err != nil {
+				return 0, err
+			}
+		case opMul:
+			b, a := vm.pop(), vm.pop()
+			if err := vm.push(a * b); err != nil {
+				return 0, err
+			}
+		case opDiv:
+			b, a := vm.pop(), vm.pop()
+			if b == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			if err := vm.push(a / b); err != nil {
+				return 0, err
+			}
+		case opMod:
+			b, a := vm.pop(), vm.pop()
+			if b == 0 {
+				return 0, fmt.Errorf("modulo by zero")
+			}
+			if err := vm.push(math.Mod(a, b)); err != nil {
+				return 0, err
+			}
+		case opPow:
+			b, a := vm.pop(), vm.pop()
+			if err := vm.push(math.Pow(a, b)); err != nil {
+				return 0, err
+			}
+		case opEq, opNeq, opLt, opLe, opGt, opGe:
+			b, a := vm.pop(), vm.pop()
+			if err := vm.push(compareFloat(in.op, a, b)); err != nil {
+				return 0, err
+			}
+		case opLoad:
+			v, ok := vars[in.name]
+			if !ok {
+				return 0, fmt.Errorf("undefined variable %q", in.name)
+			}
+			if err := vm.push(v); err != nil {
+				return 0, err
+			}
+		case opCall:
+			fn, ok := builtins[in.name]
+			if !ok {
+				return 0, fmt.Errorf("unknown function %q", in.name)
+			}
+			if in.nargs != fn.arity {
+				return 0, fmt.Errorf("%s takes %d argument(s), got %d", in.name, fn.arity, in.nargs)
+			}
+			args := make([]float64, in.nargs)
+			for i := in.nargs - 1; i >= 0; i-- {
+				args[i] = vm.pop()
+			}
+			result, err := fn.fn(args)
+			if err != nil {
+				return 0, err
+			}
+			if err := vm.push(result); err != nil {
+				return 0, err
+			}
+		default:
+			return 0, fmt.Errorf("vm: unknown opcode %v", in.op)
+		}
+	}
+	if vm.sp != 1 {
+		return 0, fmt.Errorf("vm: invalid program: stack has %d values at end, want 1", vm.sp)
+	}
+	return vm.pop(), nil
+}
+
+func compareFloat(op opcode, a, b float64) float64 {
+	var result bool
+	switch op {
+	case opEq:
+		result = a == b
+	case opNeq:
+		result = a != b
+	case opLt:
+		result = a < b
+	case opLe:
+		result = a <= b
+	case opGt:
+		result = a > b
+	case opGe:
+		result = a >= b
+	}
+	if result {
+		return 1
+	}
+	return 0
+}